@@ -0,0 +1,269 @@
+//  Copyright (c) 2015 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the
+//  License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing,
+//  software distributed under the License is distributed on an "AS
+//  IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+//  express or implied. See the License for the specific language
+//  governing permissions and limitations under the License.
+
+package ghistogram
+
+import (
+	"math"
+	"sync"
+)
+
+// DefaultExponentialHistogramMaxSize is the MaxSize used by
+// NewExponentialHistogram when given a maxSize <= 0.
+const DefaultExponentialHistogramMaxSize = 160
+
+// maxScale is the finest starting scale; ExponentialHistogram
+// downscales (coarsens) from here as needed to stay within MaxSize.
+const maxScale = 20
+
+// ExponentialHistogram is a sparse, base-2 exponential-bucket
+// histogram of uint64's, sibling to Histogram.  Unlike Histogram,
+// it does not require numBins/binFirst/binGrowthFactor to be
+// guessed up front: buckets are keyed by index and grow on demand,
+// with automatic downscaling (bucket-pair merging) to stay within
+// MaxSize.  This follows the OpenTelemetry exponential-histogram
+// scheme, so two ExponentialHistograms remain mergeable via Merge
+// even when they were built over very different ranges.
+//
+// The histogram is concurrent safe.
+type ExponentialHistogram struct {
+	// Buckets holds event counts for positive data points.  Bucket
+	// i (0-based) covers the range "[base^(i+Offset),
+	// base^(i+Offset+1))", where base == 2^(2^-Scale).
+	Buckets []uint64
+
+	// Offset is the bucket index represented by Buckets[0].
+	Offset int
+
+	// Scale controls bucket width (base == 2^(2^-Scale)); it only
+	// ever decreases, via downscale(), to keep len(Buckets) <=
+	// MaxSize.
+	Scale int
+
+	// ZeroCount counts data points of exactly 0, which have no
+	// logarithm and so don't fit into Buckets.
+	ZeroCount uint64
+
+	// MaxSize bounds the number of live buckets.  Recording a data
+	// point that would grow Buckets past MaxSize instead decrements
+	// Scale and merges bucket pairs until it fits.
+	MaxSize int
+
+	// TotCount is the sum of all counts, including ZeroCount.
+	TotCount uint64
+
+	TotDataPoint uint64 // TotDataPoint is the sum of all data points.
+	MinDataPoint uint64 // MinDataPoint is the smallest data point seen.
+	MaxDataPoint uint64 // MaxDataPoint is the largest data point seen.
+
+	m sync.Mutex
+}
+
+// NewExponentialHistogram creates a new, ready to use
+// ExponentialHistogram.  A maxSize <= 0 uses
+// DefaultExponentialHistogramMaxSize.
+func NewExponentialHistogram(maxSize int) *ExponentialHistogram {
+	if maxSize <= 0 {
+		maxSize = DefaultExponentialHistogramMaxSize
+	}
+
+	return &ExponentialHistogram{
+		Scale:        maxScale,
+		MaxSize:      maxSize,
+		MinDataPoint: math.MaxUint64,
+	}
+}
+
+// expBase returns the bucket growth factor for the given scale, base
+// == 2^(2^-scale).
+func expBase(scale int) float64 {
+	return math.Pow(2, math.Pow(2, float64(-scale)))
+}
+
+// expIndexOf returns the bucket index for dataPoint at the given
+// scale.  dataPoint must be > 0.
+func expIndexOf(dataPoint uint64, scale int) int {
+	return int(math.Floor(math.Log(float64(dataPoint)) / math.Log(expBase(scale))))
+}
+
+// Add increases the count for the given dataPoint, growing and, if
+// needed, downscaling Buckets to keep it within MaxSize.
+func (eh *ExponentialHistogram) Add(dataPoint uint64, count uint64) {
+	eh.m.Lock()
+
+	if dataPoint == 0 {
+		eh.ZeroCount += count
+	} else {
+		eh.record(expIndexOf(dataPoint, eh.Scale), count)
+	}
+
+	eh.TotCount += count
+	eh.TotDataPoint += dataPoint
+	if eh.MinDataPoint > dataPoint {
+		eh.MinDataPoint = dataPoint
+	}
+	if eh.MaxDataPoint < dataPoint {
+		eh.MaxDataPoint = dataPoint
+	}
+
+	eh.m.Unlock()
+}
+
+// record adds count into the bucket for idx, growing Buckets and
+// downscaling as needed so the live bucket count stays <= MaxSize.
+// The caller must hold eh.m.
+func (eh *ExponentialHistogram) record(idx int, count uint64) {
+	if len(eh.Buckets) == 0 {
+		eh.Buckets = make([]uint64, 1)
+		eh.Offset = idx
+	}
+
+	for idx < eh.Offset || idx >= eh.Offset+len(eh.Buckets) {
+		lo, hi := eh.Offset, eh.Offset+len(eh.Buckets)-1
+		if idx < lo {
+			lo = idx
+		}
+		if idx > hi {
+			hi = idx
+		}
+
+		if hi-lo+1 > eh.MaxSize {
+			eh.downscale()
+			idx = idx >> 1
+		} else {
+			eh.growTo(lo, hi)
+		}
+	}
+
+	eh.Buckets[idx-eh.Offset] += count
+}
+
+// growTo expands Buckets so it spans bucket indexes [lo, hi]. The
+// caller must hold eh.m.
+func (eh *ExponentialHistogram) growTo(lo, hi int) {
+	grown := make([]uint64, hi-lo+1)
+	copy(grown[eh.Offset-lo:], eh.Buckets)
+	eh.Buckets = grown
+	eh.Offset = lo
+}
+
+// downscale decrements Scale (doubling bucket width), merging bucket i
+// and i+1 into bucket i>>1.  The caller must hold eh.m.
+func (eh *ExponentialHistogram) downscale() {
+	eh.Offset, eh.Buckets = downscaleBuckets(eh.Offset, eh.Buckets)
+	eh.Scale--
+}
+
+// downscaleBuckets merges adjacent bucket pairs of buckets (indexed
+// from offset) the way a Scale decrement of 1 requires: old index i
+// maps to new index i>>1.
+func downscaleBuckets(offset int, buckets []uint64) (int, []uint64) {
+	if len(buckets) == 0 {
+		return offset >> 1, buckets
+	}
+
+	newOffset := offset >> 1
+	newLen := (offset+len(buckets)-1)>>1 - newOffset + 1
+	merged := make([]uint64, newLen)
+
+	for i, c := range buckets {
+		if c == 0 {
+			continue
+		}
+		newIdx := (offset + i) >> 1
+		merged[newIdx-newOffset] += c
+	}
+
+	return newOffset, merged
+}
+
+// Merge folds all the counts from src into this histogram.  If src
+// was recorded at a finer Scale than eh (or vice versa), the
+// finer-scaled operand is downscaled to match before merging, per
+// the standard OpenTelemetry exponential-histogram merge algorithm.
+func (eh *ExponentialHistogram) Merge(src *ExponentialHistogram) {
+	src.m.Lock()
+	defer src.m.Unlock()
+
+	eh.m.Lock()
+	defer eh.m.Unlock()
+
+	srcOffset, srcBuckets, srcScale := src.Offset, src.Buckets, src.Scale
+
+	for srcScale > eh.Scale {
+		srcOffset, srcBuckets = downscaleBuckets(srcOffset, srcBuckets)
+		srcScale--
+	}
+	for eh.Scale > srcScale {
+		eh.downscale()
+	}
+
+	for i, c := range srcBuckets {
+		if c > 0 {
+			// record may downscale eh part way through, so bring each
+			// src index down to eh's current Scale first.
+			eh.record((srcOffset+i)>>uint(srcScale-eh.Scale), c)
+		}
+	}
+
+	eh.ZeroCount += src.ZeroCount
+	eh.TotCount += src.TotCount
+
+	eh.TotDataPoint += src.TotDataPoint
+	if eh.MinDataPoint > src.MinDataPoint {
+		eh.MinDataPoint = src.MinDataPoint
+	}
+	if eh.MaxDataPoint < src.MaxDataPoint {
+		eh.MaxDataPoint = src.MaxDataPoint
+	}
+}
+
+// Quantile returns an estimate of the data point at the given
+// quantile (0.0 to 1.0), interpolating within the bucket that holds
+// the "q*TotCount"-th sample, analogous to Histogram.Quantile.
+func (eh *ExponentialHistogram) Quantile(q float64) uint64 {
+	eh.m.Lock()
+	defer eh.m.Unlock()
+
+	if eh.TotCount == 0 {
+		return 0
+	}
+
+	target := q * float64(eh.TotCount)
+
+	runCount := float64(eh.ZeroCount)
+	if runCount >= target {
+		return 0
+	}
+
+	b := expBase(eh.Scale)
+
+	for i, c := range eh.Buckets {
+		next := runCount + float64(c)
+		if next >= target {
+			idx := eh.Offset + i
+			lo := math.Pow(b, float64(idx))
+
+			if c == 0 {
+				return uint64(lo)
+			}
+
+			hi := math.Pow(b, float64(idx+1))
+			frac := (target - runCount) / float64(c)
+
+			return uint64(lo + frac*(hi-lo))
+		}
+
+		runCount = next
+	}
+
+	return eh.MaxDataPoint
+}
@@ -0,0 +1,78 @@
+package ghistogram
+
+import (
+	"testing"
+)
+
+func TestExponentialHistogramAdd(t *testing.T) {
+	eh := NewExponentialHistogram(160)
+
+	eh.Add(0, 1)
+	eh.Add(1, 2)
+	eh.Add(100, 3)
+
+	if eh.ZeroCount != 1 {
+		t.Errorf("expected ZeroCount 1, got %d", eh.ZeroCount)
+	}
+	if eh.TotCount != 6 {
+		t.Errorf("expected TotCount 6, got %d", eh.TotCount)
+	}
+	if eh.MinDataPoint != 0 || eh.MaxDataPoint != 100 {
+		t.Errorf("expected min/max 0/100, got %d/%d",
+			eh.MinDataPoint, eh.MaxDataPoint)
+	}
+}
+
+func TestExponentialHistogramDownscale(t *testing.T) {
+	eh := NewExponentialHistogram(4)
+
+	for i := uint64(1); i <= 1000; i++ {
+		eh.Add(i, 1)
+	}
+
+	if len(eh.Buckets) > eh.MaxSize {
+		t.Errorf("expected len(Buckets) <= MaxSize (%d), got %d",
+			eh.MaxSize, len(eh.Buckets))
+	}
+	if eh.TotCount != 1000 {
+		t.Errorf("expected TotCount 1000, got %d", eh.TotCount)
+	}
+}
+
+func TestExponentialHistogramMerge(t *testing.T) {
+	a := NewExponentialHistogram(160)
+	b := NewExponentialHistogram(160)
+
+	for i := uint64(1); i <= 50; i++ {
+		a.Add(i, 1)
+	}
+	for i := uint64(1); i <= 500; i++ {
+		b.Add(i, 1)
+	}
+
+	a.Merge(b)
+
+	if a.TotCount != 550 {
+		t.Errorf("expected merged TotCount 550, got %d", a.TotCount)
+	}
+	if a.MaxDataPoint != 500 {
+		t.Errorf("expected merged MaxDataPoint 500, got %d", a.MaxDataPoint)
+	}
+}
+
+func TestExponentialHistogramQuantile(t *testing.T) {
+	eh := NewExponentialHistogram(160)
+
+	if eh.Quantile(0.5) != 0 {
+		t.Errorf("expected empty histogram to quantile to 0")
+	}
+
+	for i := uint64(1); i <= 1000; i++ {
+		eh.Add(i, 1)
+	}
+
+	median := eh.Quantile(0.5)
+	if median < 400 || median > 600 {
+		t.Errorf("expected p50 near 500, got %d", median)
+	}
+}
@@ -17,8 +17,11 @@ import (
 	"bytes"
 	"fmt"
 	"math"
+	"sort"
 	"strconv"
 	"sync"
+	"sync/atomic"
+	"unsafe"
 )
 
 // Histogram is a simple uint64 histogram implementation that avoids
@@ -33,7 +36,18 @@ import (
 // An optional growth factor for bin sizes is supported - see
 // NewHistogram() binGrowthFactor parameter.
 //
-// The histogram is concurrent safe.
+// The histogram is concurrent safe.  Add never blocks: it updates
+// Counts, TotCount, TotDataPoint, TotDataPointSq, MinDataPoint and
+// MaxDataPoint with atomic operations.  Every other method that
+// touches those same fields - including AddAll and
+// ShardedHistogram.Snapshot, which read another Histogram's fields
+// directly - also goes through atomic loads/stores on them instead
+// of relying on gh.m, precisely so that an Add racing a reader stays
+// well-defined.  The exceptions are UnmarshalBinary and
+// UnmarshalJSON, which replace these fields with plain stores under
+// gh.m and so must not run concurrently with Add.  gh.m itself still exists to give callers of
+// CallSync a way to group a read-modify-write sequence atomically
+// with respect to other CallSync callers; it does not exclude Add.
 type Histogram struct {
 	// Ranges holds the lower domain bounds of bins, so bin i has data
 	// point domain of "[Ranges[i], Ranges[i+1])".  Related,
@@ -50,6 +64,20 @@ type Histogram struct {
 	MinDataPoint uint64 // MinDataPoint is the smallest data point seen.
 	MaxDataPoint uint64 // MaxDataPoint is the largest data point seen.
 
+	// TotDataPointSq is the sum of the squares of all data points,
+	// tracked alongside TotDataPoint so StdDev() can compute a
+	// running variance without re-walking Counts.
+	//
+	// It's a float64, not a uint64 like the other totals: a uint64
+	// sum of squares overflows silently once data points reach
+	// roughly 1e9 (a plausible nanosecond latency), after which
+	// StdDev() would return garbage with no indication anything went
+	// wrong.  float64 trades away a little low-order precision for
+	// headroom up to ~1e154 before overflow. It's updated via
+	// addFloat64's atomic compare-and-swap loop, since sync/atomic
+	// has no native float64 add.
+	TotDataPointSq float64
+
 	m sync.Mutex
 }
 
@@ -87,24 +115,292 @@ func NewHistogram(
 }
 
 // Add increases the count in the bin for the given dataPoint.
+//
+// Add does not take gh.m, so it never blocks on or serializes
+// against other concurrent Add calls: the bin count and the running
+// totals are updated with atomic.AddUint64, and MinDataPoint /
+// MaxDataPoint are updated via atomic compare-and-swap loops.
+// Readers (EmitGraph, AddAll, Quantile and friends, the Marshal*
+// methods) still take gh.m to serialize against each other, but read
+// these same fields with atomic loads rather than plain field
+// accesses, since gh.m does not exclude Add; under heavy concurrent
+// Add traffic such a snapshot may observe counts from slightly
+// different moments in time, the usual trade-off for a lock-free hot
+// path.
 func (gh *Histogram) Add(dataPoint uint64, count uint64) {
+	idx := search(gh.Ranges, dataPoint)
+	if idx < 0 {
+		return
+	}
+
+	atomic.AddUint64(&gh.Counts[idx], count)
+	atomic.AddUint64(&gh.TotCount, count)
+	atomic.AddUint64(&gh.TotDataPoint, dataPoint)
+	addFloat64(&gh.TotDataPointSq, float64(dataPoint)*float64(dataPoint))
+
+	for {
+		min := atomic.LoadUint64(&gh.MinDataPoint)
+		if dataPoint >= min ||
+			atomic.CompareAndSwapUint64(&gh.MinDataPoint, min, dataPoint) {
+			break
+		}
+	}
+
+	for {
+		max := atomic.LoadUint64(&gh.MaxDataPoint)
+		if dataPoint <= max ||
+			atomic.CompareAndSwapUint64(&gh.MaxDataPoint, max, dataPoint) {
+			break
+		}
+	}
+}
+
+// addFloat64 atomically adds delta to *addr, via a compare-and-swap
+// loop over its bit pattern since sync/atomic has no native float64
+// add.
+func addFloat64(addr *float64, delta float64) {
+	bits := (*uint64)(unsafe.Pointer(addr))
+	for {
+		old := atomic.LoadUint64(bits)
+		newF := math.Float64frombits(old) + delta
+		if atomic.CompareAndSwapUint64(bits, old, math.Float64bits(newF)) {
+			return
+		}
+	}
+}
+
+// loadFloat64 atomically reads *addr.
+func loadFloat64(addr *float64) float64 {
+	return math.Float64frombits(atomic.LoadUint64((*uint64)(unsafe.Pointer(addr))))
+}
+
+// NewLogLinearHistogram creates a new, ready to use Histogram whose
+// bins are laid out log-linearly instead of by a growth factor:
+// each decade (power of ten) from 10^0 up to 10^(decades-1) is split
+// into subBuckets equal-width divisions, so a data point v falling
+// in decade d lands in bin "1 + d*subBuckets +
+// floor(subBuckets*(v/10^d - 1)/9)" (bin 0 holds [0, 1), and the
+// last bin is open-ended, also taking every v above it).  A bin's
+// width relative to its lower bound runs from about 9/subBuckets at
+// the start of a decade down to about 1/subBuckets at its end (e.g.
+// ~9% to ~1% at subBuckets == 100), and that profile repeats in
+// every decade no matter how large v is, unlike NewHistogram's
+// binGrowthFactor bins whose absolute width grows with each
+// successive bin.
+//
+// Because the bin boundaries depend only on (decades, subBuckets),
+// any two histograms created with the same parameters share
+// identical Ranges, so they remain composable via AddAll no matter
+// what values were actually observed.
+//
+// Those relative widths only hold once a
+// decade's integer boundaries ("base * (1 + 9*sub/subBuckets)",
+// rounded up) are themselves distinct: in decade 0 (base == 1) with
+// subBuckets above roughly 9, several adjacent sub-bucket boundaries
+// round up to the same integer, collapsing those bins to zero width
+// and leaving them permanently dead.  Values well below 10^1 with a
+// large subBuckets are the affected range; callers bucketing such
+// small values should use a smaller subBuckets or a non-zero floor.
+func NewLogLinearHistogram(decades int, subBuckets int) *Histogram {
+	numBins := decades*subBuckets + 1
+
+	gh := &Histogram{
+		Ranges:       make([]uint64, numBins),
+		Counts:       make([]uint64, numBins),
+		TotCount:     0,
+		MinDataPoint: math.MaxUint64,
+		MaxDataPoint: 0,
+	}
+
+	gh.Ranges[0] = 0
+
+	for decade := 0; decade < decades; decade++ {
+		base := math.Pow(10, float64(decade))
+		for sub := 0; sub < subBuckets; sub++ {
+			gh.Ranges[decade*subBuckets+sub+1] =
+				uint64(math.Ceil(base * (1.0 + 9.0*float64(sub)/float64(subBuckets))))
+		}
+	}
+
+	return gh
+}
+
+// Quantile returns an estimate of the data point at the given
+// quantile (0.0 to 1.0), such as 0.99 for p99.  It locates the bin
+// holding the "q*TotCount"-th sample and linearly interpolates
+// within that bin's [Ranges[i], Ranges[i+1]) span; the final,
+// open-ended bin interpolates up to MaxDataPoint instead of
+// assuming an infinite upper bound.
+func (gh *Histogram) Quantile(q float64) uint64 {
 	gh.m.Lock()
+	defer gh.m.Unlock()
 
-	idx := search(gh.Ranges, dataPoint)
-	if idx >= 0 {
-		gh.Counts[idx] += count
-		gh.TotCount += count
+	totCount := atomic.LoadUint64(&gh.TotCount)
+	if totCount == 0 {
+		return 0
+	}
+
+	return gh.quantileLocked(q * float64(totCount))
+}
+
+// Quantiles is like Quantile, but answers many quantiles with a
+// single pass over Counts instead of one pass per quantile.  The
+// returned slice has one entry per entry of qs, in the same order.
+func (gh *Histogram) Quantiles(qs []float64) []uint64 {
+	gh.m.Lock()
+	defer gh.m.Unlock()
+
+	out := make([]uint64, len(qs))
+
+	totCount := atomic.LoadUint64(&gh.TotCount)
+	if totCount == 0 || len(qs) == 0 {
+		return out
+	}
+
+	// Answer the quantiles in ascending order of their target
+	// sample count, so the single forward pass below can satisfy
+	// each one as soon as it's reached.
+	order := make([]int, len(qs))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(a, b int) bool { return qs[order[a]] < qs[order[b]] })
+
+	oi := 0
+	var runCount uint64
+	for i := range gh.Counts {
+		c := atomic.LoadUint64(&gh.Counts[i])
+		next := runCount + c
+		for oi < len(order) && float64(next) >= qs[order[oi]]*float64(totCount) {
+			out[order[oi]] = gh.interpolateBin(i, runCount, c, qs[order[oi]]*float64(totCount))
+			oi++
+		}
+		runCount = next
+	}
+	for ; oi < len(order); oi++ {
+		out[order[oi]] = atomic.LoadUint64(&gh.MaxDataPoint)
+	}
 
-		gh.TotDataPoint += dataPoint
-		if gh.MinDataPoint > dataPoint {
-			gh.MinDataPoint = dataPoint
+	return out
+}
+
+// quantileLocked finds the bin holding the "target"-th sample and
+// interpolates within it.  The caller must hold gh.m.
+func (gh *Histogram) quantileLocked(target float64) uint64 {
+	var runCount uint64
+	for i := range gh.Counts {
+		c := atomic.LoadUint64(&gh.Counts[i])
+		next := runCount + c
+		if float64(next) >= target {
+			return gh.interpolateBin(i, runCount, c, target)
 		}
-		if gh.MaxDataPoint < dataPoint {
-			gh.MaxDataPoint = dataPoint
+		runCount = next
+	}
+
+	return atomic.LoadUint64(&gh.MaxDataPoint)
+}
+
+// interpolateBin linearly interpolates within bin i's
+// [Ranges[i], Ranges[i+1]) span (or up to MaxDataPoint for the
+// final, open-ended bin) to estimate the value at the "target"-th
+// sample overall, given that "before" samples preceded bin i and
+// bin i itself holds c samples.  The caller must hold gh.m.
+func (gh *Histogram) interpolateBin(i int, before uint64, c uint64, target float64) uint64 {
+	lo := gh.Ranges[i]
+
+	var hi uint64
+	if i+1 < len(gh.Ranges) {
+		hi = gh.Ranges[i+1]
+	} else {
+		hi = atomic.LoadUint64(&gh.MaxDataPoint)
+	}
+
+	if c == 0 || hi <= lo {
+		return lo
+	}
+
+	frac := (target - float64(before)) / float64(c)
+
+	return lo + uint64(frac*float64(hi-lo))
+}
+
+// CDF returns the fraction (0.0 to 1.0) of samples with a data
+// point <= x, linearly interpolating within the bin containing x.
+func (gh *Histogram) CDF(x uint64) float64 {
+	gh.m.Lock()
+	defer gh.m.Unlock()
+
+	totCount := atomic.LoadUint64(&gh.TotCount)
+	if totCount == 0 {
+		return 0
+	}
+
+	idx := search(gh.Ranges, x)
+	if idx < 0 {
+		return 0
+	}
+
+	var before uint64
+	for i := 0; i < idx; i++ {
+		before += atomic.LoadUint64(&gh.Counts[i])
+	}
+
+	lo := gh.Ranges[idx]
+
+	var hi uint64
+	if idx+1 < len(gh.Ranges) {
+		hi = gh.Ranges[idx+1]
+	} else {
+		hi = atomic.LoadUint64(&gh.MaxDataPoint)
+	}
+
+	idxCount := atomic.LoadUint64(&gh.Counts[idx])
+	within := float64(idxCount)
+	if idxCount > 0 && hi > lo {
+		frac := float64(x-lo) / float64(hi-lo)
+		if frac > 1.0 {
+			frac = 1.0
 		}
+		within = frac * float64(idxCount)
 	}
 
-	gh.m.Unlock()
+	return (float64(before) + within) / float64(totCount)
+}
+
+// Mean returns the arithmetic mean of all recorded data points.
+func (gh *Histogram) Mean() float64 {
+	gh.m.Lock()
+	defer gh.m.Unlock()
+
+	totCount := atomic.LoadUint64(&gh.TotCount)
+	if totCount == 0 {
+		return 0
+	}
+
+	return float64(atomic.LoadUint64(&gh.TotDataPoint)) / float64(totCount)
+}
+
+// StdDev returns the population standard deviation of all recorded
+// data points, computed from the running TotDataPoint and
+// TotDataPointSq sums rather than by re-walking Counts.
+func (gh *Histogram) StdDev() float64 {
+	gh.m.Lock()
+	defer gh.m.Unlock()
+
+	totCount := atomic.LoadUint64(&gh.TotCount)
+	if totCount == 0 {
+		return 0
+	}
+
+	totCountF := float64(totCount)
+	mean := float64(atomic.LoadUint64(&gh.TotDataPoint)) / totCountF
+
+	variance := loadFloat64(&gh.TotDataPointSq)/totCountF - mean*mean
+	if variance < 0 {
+		variance = 0 // Guard against floating-point rounding noise.
+	}
+
+	return math.Sqrt(variance)
 }
 
 // Finds the last arr index where the arr entry <= dataPoint.
@@ -126,21 +422,39 @@ func search(arr []uint64, dataPoint uint64) int {
 // AddAll adds all the Counts from the src histogram into this
 // histogram.  The src and this histogram must either have the same
 // exact creation parameters.
+//
+// gh.m and src.m only serialize AddAll (and the Marshal*/EmitGraph
+// readers) against each other; src may still have concurrent Add
+// calls in flight, so every field read or written here goes through
+// atomic operations rather than gh.m/src.m alone.
 func (gh *Histogram) AddAll(src *Histogram) {
 	src.m.Lock()
 	gh.m.Lock()
 
 	for i := 0; i < len(src.Counts); i++ {
-		gh.Counts[i] += src.Counts[i]
+		atomic.AddUint64(&gh.Counts[i], atomic.LoadUint64(&src.Counts[i]))
 	}
-	gh.TotCount += src.TotCount
+	atomic.AddUint64(&gh.TotCount, atomic.LoadUint64(&src.TotCount))
 
-	gh.TotDataPoint += src.TotDataPoint
-	if gh.MinDataPoint > src.MinDataPoint {
-		gh.MinDataPoint = src.MinDataPoint
+	atomic.AddUint64(&gh.TotDataPoint, atomic.LoadUint64(&src.TotDataPoint))
+	addFloat64(&gh.TotDataPointSq, loadFloat64(&src.TotDataPointSq))
+
+	srcMin := atomic.LoadUint64(&src.MinDataPoint)
+	for {
+		min := atomic.LoadUint64(&gh.MinDataPoint)
+		if min <= srcMin ||
+			atomic.CompareAndSwapUint64(&gh.MinDataPoint, min, srcMin) {
+			break
+		}
 	}
-	if gh.MaxDataPoint < src.MaxDataPoint {
-		gh.MaxDataPoint = src.MaxDataPoint
+
+	srcMax := atomic.LoadUint64(&src.MaxDataPoint)
+	for {
+		max := atomic.LoadUint64(&gh.MaxDataPoint)
+		if max >= srcMax ||
+			atomic.CompareAndSwapUint64(&gh.MaxDataPoint, max, srcMax) {
+			break
+		}
 	}
 
 	gh.m.Unlock()
@@ -161,8 +475,14 @@ func (gh *Histogram) EmitGraph(prefix []byte,
 
 	ranges := gh.Ranges
 	rangesN := len(ranges)
-	counts := gh.Counts
-	countsN := len(counts)
+	countsN := len(gh.Counts)
+
+	// Copy Counts via atomic loads: gh.m doesn't exclude a
+	// concurrent Add, so a plain range over gh.Counts could race.
+	counts := make([]uint64, countsN)
+	for i := range counts {
+		counts[i] = atomic.LoadUint64(&gh.Counts[i])
+	}
 
 	if out == nil {
 		out = bytes.NewBuffer(make([]byte, 0, 80*countsN))
@@ -175,7 +495,7 @@ func (gh *Histogram) EmitGraph(prefix []byte,
 		}
 	}
 	maxCountF := float64(maxCount)
-	totCountF := float64(gh.TotCount)
+	totCountF := float64(atomic.LoadUint64(&gh.TotCount))
 
 	widthRange := len(strconv.Itoa(int(ranges[rangesN-1])))
 	widthWidth := len(strconv.Itoa(int(ranges[rangesN-1] - ranges[rangesN-2])))
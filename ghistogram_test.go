@@ -6,37 +6,36 @@ import (
 
 func TestSearch(t *testing.T) {
 	tests := []struct {
-		arr []int
-		val int
+		arr []uint64
+		val uint64
 		exp int
 	}{
-		{[]int(nil), 0, -1},
-		{[]int(nil), 100, -1},
-		{[]int(nil), -100, -1},
+		{[]uint64(nil), 0, -1},
+		{[]uint64(nil), 100, -1},
 
-		{[]int{0}, 0, 0},
-		{[]int{0, 10}, 0, 0},
-		{[]int{0, 10, 20}, 0, 0},
+		{[]uint64{0}, 0, 0},
+		{[]uint64{0, 10}, 0, 0},
+		{[]uint64{0, 10, 20}, 0, 0},
 
-		{[]int{0}, 1, 0},
-		{[]int{0, 10}, 1, 0},
-		{[]int{0, 10, 20}, 1, 0},
+		{[]uint64{0}, 1, 0},
+		{[]uint64{0, 10}, 1, 0},
+		{[]uint64{0, 10, 20}, 1, 0},
 
-		{[]int{0}, 10, 0},
-		{[]int{0, 10}, 10, 1},
-		{[]int{0, 10, 20}, 10, 1},
+		{[]uint64{0}, 10, 0},
+		{[]uint64{0, 10}, 10, 1},
+		{[]uint64{0, 10, 20}, 10, 1},
 
-		{[]int{0}, 15, 0},
-		{[]int{0, 10}, 15, 1},
-		{[]int{0, 10, 20}, 15, 1},
+		{[]uint64{0}, 15, 0},
+		{[]uint64{0, 10}, 15, 1},
+		{[]uint64{0, 10, 20}, 15, 1},
 
-		{[]int{0}, 20, 0},
-		{[]int{0, 10}, 20, 1},
-		{[]int{0, 10, 20}, 20, 2},
+		{[]uint64{0}, 20, 0},
+		{[]uint64{0, 10}, 20, 1},
+		{[]uint64{0, 10, 20}, 20, 2},
 
-		{[]int{0}, 30, 0},
-		{[]int{0, 10}, 30, 1},
-		{[]int{0, 10, 20}, 30, 2},
+		{[]uint64{0}, 30, 0},
+		{[]uint64{0, 10}, 30, 1},
+		{[]uint64{0, 10, 20}, 30, 2},
 	}
 
 	for testi, test := range tests {
@@ -58,15 +57,15 @@ func TestSearch(t *testing.T) {
 func TestNewHistogram(t *testing.T) {
 	tests := []struct {
 		numBins         int
-		binFirst        int
+		binFirst        uint64
 		binGrowthFactor float64
-		exp             []int
+		exp             []uint64
 	}{
-		{2, 123, 10.0, []int{0, 123}},
-		{2, 123, 10.0, []int{0, 123}},
+		{2, 123, 10.0, []uint64{0, 123}},
+		{2, 123, 10.0, []uint64{0, 123}},
 
-		{5, 10, 2.0, []int{0, 10, 20, 40, 80}},
-		{5, 10, 1.5, []int{0, 10, 15, 23, 35}},
+		{5, 10, 2.0, []uint64{0, 10, 20, 40, 80}},
+		{5, 10, 1.5, []uint64{0, 10, 15, 23, 35}},
 	}
 
 	for testi, test := range tests {
@@ -95,7 +94,7 @@ func TestAdd(t *testing.T) {
 	gh := NewHistogram(5, 10, 2.0)
 
 	tests := []struct {
-		val int
+		val uint64
 		exp []uint64
 	}{
 		{0, []uint64{1, 0, 0, 0, 0}},
@@ -131,6 +130,47 @@ func TestAdd(t *testing.T) {
 	}
 }
 
+func TestNewLogLinearHistogram(t *testing.T) {
+	gh := NewLogLinearHistogram(2, 4)
+
+	if len(gh.Ranges) != len(gh.Counts) {
+		t.Errorf("mismatched len's")
+	}
+	if len(gh.Ranges) != 2*4+1 {
+		t.Errorf("wrong len's")
+	}
+
+	exp := []uint64{0, 1, 4, 6, 8, 10, 33, 55, 78}
+	for i := 0; i < len(gh.Ranges); i++ {
+		if gh.Ranges[i] != exp[i] {
+			t.Errorf("actual (%v) != exp (%v)", gh.Ranges, exp)
+		}
+	}
+
+	gh2 := NewLogLinearHistogram(2, 4)
+	gh.Add(5, 1)
+	gh2.AddAll(gh)
+	if gh2.TotCount != 1 {
+		t.Errorf("expected AddAll to compose across matching params")
+	}
+}
+
+func TestQuantile(t *testing.T) {
+	gh := NewHistogram(5, 10, 2.0) // Bins: {0, 10, 20, 40, 80}.
+
+	if gh.Quantile(0.5) != 0 {
+		t.Errorf("expected empty histogram to quantile to 0")
+	}
+
+	for i := 0; i < 100; i++ {
+		gh.Add(15, 1)
+	}
+
+	if got := gh.Quantile(0.5); got < 10 || got >= 20 {
+		t.Errorf("expected p50 within the [10, 20) bin, got %d", got)
+	}
+}
+
 func TestAddAll(t *testing.T) {
 	// Bins will look like: {0, 10, 20, 40, 80}.
 	gh := NewHistogram(5, 10, 2.0)
@@ -0,0 +1,50 @@
+//  Copyright (c) 2015 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the
+//  License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing,
+//  software distributed under the License is distributed on an "AS
+//  IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+//  express or implied. See the License for the specific language
+//  governing permissions and limitations under the License.
+
+// Package otelexport adapts a *ghistogram.Histogram to
+// OpenTelemetry, producing a metricdata.HistogramDataPoint suitable
+// for a metric exporter.
+package otelexport
+
+import (
+	"github.com/couchbaselabs/ghistogram"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// ToHistogramDataPoint converts gh into an OpenTelemetry
+// metricdata.HistogramDataPoint[float64] (the OTel SDK's generic
+// histogram value type is constrained to int64|float64, so uint64
+// fields are widened).  OpenTelemetry requires
+// len(BucketCounts) == len(Bounds)+1, so the explicit bounds are
+// gh.Ranges[1:] (gh's Ranges[0] == 0 is always implicit, never a
+// real bound) while BucketCounts is all of gh.Counts: bucket i is
+// gh's bin i, [Ranges[i], Ranges[i+1]).  gh's bins include their
+// lower bound, so a data point exactly on a bound is counted in the
+// bucket above that bound, not in the upper-inclusive bucket
+// OpenTelemetry reads it as.
+func ToHistogramDataPoint(gh *ghistogram.Histogram) metricdata.HistogramDataPoint[float64] {
+	bounds := make([]float64, len(gh.Ranges)-1)
+	for i, r := range gh.Ranges[1:] {
+		bounds[i] = float64(r)
+	}
+
+	bucketCounts := make([]uint64, len(gh.Counts))
+	copy(bucketCounts, gh.Counts)
+
+	return metricdata.HistogramDataPoint[float64]{
+		Count:        gh.TotCount,
+		Sum:          float64(gh.TotDataPoint),
+		Bounds:       bounds,
+		BucketCounts: bucketCounts,
+		Min:          metricdata.NewExtrema(float64(gh.MinDataPoint)),
+		Max:          metricdata.NewExtrema(float64(gh.MaxDataPoint)),
+	}
+}
@@ -0,0 +1,32 @@
+package otelexport
+
+import (
+	"testing"
+
+	"github.com/couchbaselabs/ghistogram"
+)
+
+func TestToHistogramDataPoint(t *testing.T) {
+	gh := ghistogram.NewHistogram(5, 10, 2.0) // Bins: {0, 10, 20, 40, 80}.
+	gh.Add(5, 3)
+	gh.Add(15, 1)
+	gh.Add(1000, 2)
+
+	dp := ToHistogramDataPoint(gh)
+
+	if len(dp.BucketCounts) != len(dp.Bounds)+1 {
+		t.Fatalf("len(BucketCounts) %d != len(Bounds)+1 %d",
+			len(dp.BucketCounts), len(dp.Bounds)+1)
+	}
+
+	var sum uint64
+	for _, c := range dp.BucketCounts {
+		sum += c
+	}
+	if sum != dp.Count {
+		t.Errorf("sum(BucketCounts) = %d, want Count %d", sum, dp.Count)
+	}
+	if dp.Count != gh.TotCount {
+		t.Errorf("Count = %d, want %d", dp.Count, gh.TotCount)
+	}
+}
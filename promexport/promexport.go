@@ -0,0 +1,139 @@
+//  Copyright (c) 2015 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the
+//  License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing,
+//  software distributed under the License is distributed on an "AS
+//  IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+//  express or implied. See the License for the specific language
+//  governing permissions and limitations under the License.
+
+// Package promexport adapts a *ghistogram.Histogram to Prometheus,
+// so it can be registered with a prometheus.Registry and scraped
+// like any other Prometheus metric.
+package promexport
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/couchbaselabs/ghistogram"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Collector implements prometheus.Collector around a
+// *ghistogram.Histogram, translating its Ranges/Counts into
+// cumulative Prometheus bucket samples ("le" labels) plus the _sum
+// and _count Prometheus derives from TotDataPoint/TotCount.
+type Collector struct {
+	gh     *ghistogram.Histogram
+	name   string
+	help   string
+	labels prometheus.Labels
+}
+
+// New wraps gh as a prometheus.Collector, exported under the given
+// metric name and help text.
+func New(gh *ghistogram.Histogram, name string, help string) *Collector {
+	return &Collector{gh: gh, name: name, help: help}
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc()
+}
+
+// Collect implements prometheus.Collector.
+//
+// A scrape runs concurrently with ghistogram.Histogram.Add, which
+// updates Counts/TotDataPoint lock-free via atomic operations, so
+// Collect reads them the same way every in-package reader does:
+// serialized against other readers via CallSync, with atomic loads
+// for the fields Add touches without taking gh.m.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	var buckets map[float64]uint64
+	var cumulative uint64
+	var totDataPoint uint64
+
+	c.gh.CallSync(func() {
+		ranges := c.gh.Ranges
+		counts := c.gh.Counts
+
+		buckets = make(map[float64]uint64, len(ranges)-1)
+
+		for i := 1; i < len(ranges); i++ {
+			cumulative += atomic.LoadUint64(&counts[i-1])
+			buckets[float64(ranges[i])] = cumulative
+		}
+		cumulative += atomic.LoadUint64(&counts[len(counts)-1])
+
+		totDataPoint = atomic.LoadUint64(&c.gh.TotDataPoint)
+	})
+
+	m, err := prometheus.NewConstHistogram(c.desc(),
+		cumulative, float64(totDataPoint), buckets)
+	if err != nil {
+		return
+	}
+
+	ch <- m
+}
+
+func (c *Collector) desc() *prometheus.Desc {
+	return prometheus.NewDesc(c.name, c.help, nil, c.labels)
+}
+
+// Ingest builds a new *ghistogram.Histogram whose Ranges match the
+// given ascending, finite Prometheus bucket upper bounds, populated
+// from that bucket's cumulative counts (as scraped from a
+// dto.Histogram) and the histogram's overall totCount/totDataPoint.
+// This is the inverse of Collect, letting a Prometheus histogram
+// scraped elsewhere be combined with a *ghistogram.Histogram via
+// AddAll.
+func Ingest(
+	bucketUpperBounds []float64,
+	cumulativeCounts []uint64,
+	totCount uint64,
+	totDataPoint uint64,
+) (*ghistogram.Histogram, error) {
+	if len(bucketUpperBounds) != len(cumulativeCounts) {
+		return nil, fmt.Errorf(
+			"promexport: Ingest: len(bucketUpperBounds) %d != len(cumulativeCounts) %d",
+			len(bucketUpperBounds), len(cumulativeCounts))
+	}
+
+	numBins := len(bucketUpperBounds) + 1
+
+	gh := &ghistogram.Histogram{
+		Ranges: make([]uint64, numBins),
+		Counts: make([]uint64, numBins),
+	}
+
+	gh.Ranges[0] = 0
+	for i, ub := range bucketUpperBounds {
+		gh.Ranges[i+1] = uint64(ub)
+	}
+
+	var prevCum uint64
+	for i, cum := range cumulativeCounts {
+		if cum < prevCum {
+			return nil, fmt.Errorf(
+				"promexport: Ingest: cumulativeCounts not non-decreasing at bucket %d", i)
+		}
+		gh.Counts[i] = cum - prevCum
+		prevCum = cum
+	}
+
+	if totCount < prevCum {
+		return nil, fmt.Errorf(
+			"promexport: Ingest: totCount %d less than last bucket's cumulative count %d",
+			totCount, prevCum)
+	}
+	gh.Counts[numBins-1] = totCount - prevCum
+
+	gh.TotCount = totCount
+	gh.TotDataPoint = totDataPoint
+
+	return gh, nil
+}
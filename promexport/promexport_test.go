@@ -0,0 +1,65 @@
+package promexport
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/couchbaselabs/ghistogram"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestCollectorCollectConcurrentWithAdd(t *testing.T) {
+	gh := ghistogram.NewHistogram(5, 10, 2.0) // Bins: {0, 10, 20, 40, 80}.
+	c := New(gh, "test_histogram", "a test histogram")
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			gh.Add(uint64(i%100), 1)
+		}
+	}()
+
+	for i := 0; i < 1000; i++ {
+		ch := make(chan prometheus.Metric, 1)
+		c.Collect(ch)
+		close(ch)
+	}
+
+	wg.Wait()
+}
+
+func TestIngestInverseOfCollect(t *testing.T) {
+	gh := ghistogram.NewHistogram(5, 10, 2.0)
+	gh.Add(5, 3)
+	gh.Add(15, 1)
+	gh.Add(1000, 2)
+
+	c := New(gh, "test_histogram", "a test histogram")
+	ch := make(chan prometheus.Metric, 1)
+	c.Collect(ch)
+	close(ch)
+
+	var m dto.Metric
+	if err := (<-ch).Write(&m); err != nil {
+		t.Fatalf("Write err: %v", err)
+	}
+
+	bounds := make([]float64, len(m.Histogram.Bucket))
+	cumulative := make([]uint64, len(m.Histogram.Bucket))
+	for i, b := range m.Histogram.Bucket {
+		bounds[i] = b.GetUpperBound()
+		cumulative[i] = b.GetCumulativeCount()
+	}
+
+	gh2, err := Ingest(bounds, cumulative, m.Histogram.GetSampleCount(), uint64(m.Histogram.GetSampleSum()))
+	if err != nil {
+		t.Fatalf("Ingest err: %v", err)
+	}
+
+	if gh2.TotCount != gh.TotCount {
+		t.Errorf("TotCount mismatch: %d vs %d", gh2.TotCount, gh.TotCount)
+	}
+}
@@ -0,0 +1,280 @@
+//  Copyright (c) 2015 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the
+//  License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing,
+//  software distributed under the License is distributed on an "AS
+//  IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+//  express or implied. See the License for the specific language
+//  governing permissions and limitations under the License.
+
+package ghistogram
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sync/atomic"
+)
+
+// histogramWireVersion is bumped whenever the MarshalBinary /
+// MarshalJSON layout changes incompatibly.
+//
+// Version 3 carries Ranges on the wire directly, rather than a
+// (binFirst, binGrowthFactor) pair for UnmarshalBinary/UnmarshalJSON
+// to replay through NewHistogram: that replay can only reproduce the
+// subset of layouts NewHistogram itself can build, and silently came
+// back wrong for e.g. NewLogLinearHistogram layouts or NewHistogram's
+// own binGrowthFactor == 0.0 constant-width mode.
+//
+// Version 4 changed TotDataPointSq from a varint uint64 to a fixed
+// 8-byte float64 (big-endian bit pattern), matching Histogram's own
+// switch to a float64 accumulator to avoid silent overflow.
+const histogramWireVersion = 4
+
+// MarshalBinary encodes the histogram into a compact binary form:
+// the version byte and numBins, then Ranges, then the running totals
+// (TotCount, TotDataPoint, TotDataPointSq as 8 fixed bytes,
+// MinDataPoint, MaxDataPoint), then Counts.  Everything but the
+// version and TotDataPointSq is varint-encoded, since most Counts
+// entries are zero for typical latency data.
+//
+// gh.m serializes MarshalBinary against other gh.m holders, but
+// doesn't exclude a concurrent Add, so every field it reads here is
+// read with an atomic load.
+func (gh *Histogram) MarshalBinary() ([]byte, error) {
+	gh.m.Lock()
+	defer gh.m.Unlock()
+
+	var buf bytes.Buffer
+
+	scratch := make([]byte, binary.MaxVarintLen64)
+
+	buf.WriteByte(histogramWireVersion)
+	putUvarint(&buf, scratch, uint64(len(gh.Ranges)))
+
+	for _, r := range gh.Ranges {
+		putUvarint(&buf, scratch, r)
+	}
+
+	putUvarint(&buf, scratch, atomic.LoadUint64(&gh.TotCount))
+	putUvarint(&buf, scratch, atomic.LoadUint64(&gh.TotDataPoint))
+
+	var totDataPointSqBits [8]byte
+	binary.BigEndian.PutUint64(totDataPointSqBits[:], math.Float64bits(loadFloat64(&gh.TotDataPointSq)))
+	buf.Write(totDataPointSqBits[:])
+
+	putUvarint(&buf, scratch, atomic.LoadUint64(&gh.MinDataPoint))
+	putUvarint(&buf, scratch, atomic.LoadUint64(&gh.MaxDataPoint))
+
+	for i := range gh.Counts {
+		putUvarint(&buf, scratch, atomic.LoadUint64(&gh.Counts[i]))
+	}
+
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodes a histogram encoded by MarshalBinary,
+// reading Ranges directly off the wire rather than reconstructing it
+// from construction parameters.  It returns an error if the count
+// vector length doesn't match the header's numBins.
+func (gh *Histogram) UnmarshalBinary(data []byte) error {
+	r := bytes.NewReader(data)
+
+	version, err := r.ReadByte()
+	if err != nil {
+		return fmt.Errorf("ghistogram: UnmarshalBinary: missing version: %v", err)
+	}
+	if version != histogramWireVersion {
+		return fmt.Errorf("ghistogram: UnmarshalBinary: unsupported version %d", version)
+	}
+
+	numBins, err := binary.ReadUvarint(r)
+	if err != nil {
+		return fmt.Errorf("ghistogram: UnmarshalBinary: bad numBins: %v", err)
+	}
+
+	ranges := make([]uint64, numBins)
+	for i := range ranges {
+		ranges[i], err = binary.ReadUvarint(r)
+		if err != nil {
+			return fmt.Errorf("ghistogram: UnmarshalBinary: bad Ranges: %v", err)
+		}
+	}
+
+	totCount, err := binary.ReadUvarint(r)
+	if err != nil {
+		return fmt.Errorf("ghistogram: UnmarshalBinary: bad TotCount: %v", err)
+	}
+	totDataPoint, err := binary.ReadUvarint(r)
+	if err != nil {
+		return fmt.Errorf("ghistogram: UnmarshalBinary: bad TotDataPoint: %v", err)
+	}
+	var totDataPointSqBits [8]byte
+	if _, err := io.ReadFull(r, totDataPointSqBits[:]); err != nil {
+		return fmt.Errorf("ghistogram: UnmarshalBinary: bad TotDataPointSq: %v", err)
+	}
+	totDataPointSq := math.Float64frombits(binary.BigEndian.Uint64(totDataPointSqBits[:]))
+	minDataPoint, err := binary.ReadUvarint(r)
+	if err != nil {
+		return fmt.Errorf("ghistogram: UnmarshalBinary: bad MinDataPoint: %v", err)
+	}
+	maxDataPoint, err := binary.ReadUvarint(r)
+	if err != nil {
+		return fmt.Errorf("ghistogram: UnmarshalBinary: bad MaxDataPoint: %v", err)
+	}
+
+	counts := make([]uint64, 0, numBins)
+	for r.Len() > 0 {
+		c, err := binary.ReadUvarint(r)
+		if err != nil {
+			return fmt.Errorf("ghistogram: UnmarshalBinary: bad Counts: %v", err)
+		}
+		counts = append(counts, c)
+	}
+	if uint64(len(counts)) != numBins {
+		return fmt.Errorf("ghistogram: UnmarshalBinary: Counts length %d != numBins %d",
+			len(counts), numBins)
+	}
+
+	gh.m.Lock()
+	gh.Ranges = ranges
+	gh.Counts = counts
+	gh.TotCount = totCount
+	gh.TotDataPoint = totDataPoint
+	gh.TotDataPointSq = totDataPointSq
+	gh.MinDataPoint = minDataPoint
+	gh.MaxDataPoint = maxDataPoint
+	gh.m.Unlock()
+
+	return nil
+}
+
+// histogramJSON is the MarshalJSON / UnmarshalJSON wire shape: the
+// header fields spelled out for readability, plus the base64 of the
+// MarshalBinary varint-encoded Ranges and Counts so JSON consumers
+// don't need to reflect over them themselves.
+type histogramJSON struct {
+	Version        uint8   `json:"version"`
+	NumBins        int     `json:"numBins"`
+	TotCount       uint64  `json:"totCount"`
+	TotDataPoint   uint64  `json:"totDataPoint"`
+	TotDataPointSq float64 `json:"totDataPointSq"`
+	MinDataPoint   uint64  `json:"minDataPoint"`
+	MaxDataPoint   uint64  `json:"maxDataPoint"`
+	Ranges         string  `json:"ranges"` // base64 of varint-encoded Ranges.
+	Counts         string  `json:"counts"` // base64 of varint-encoded Counts.
+}
+
+// MarshalJSON encodes the histogram as JSON, suitable for embedding
+// in text protocols; Ranges and Counts are each carried as a
+// base64'd varint blob rather than a JSON array to keep the payload
+// small.
+//
+// gh.m serializes MarshalJSON against other gh.m holders, but
+// doesn't exclude a concurrent Add, so every field it reads here is
+// read with an atomic load.
+func (gh *Histogram) MarshalJSON() ([]byte, error) {
+	gh.m.Lock()
+
+	scratch := make([]byte, binary.MaxVarintLen64)
+
+	var rangesBuf bytes.Buffer
+	for _, r := range gh.Ranges {
+		putUvarint(&rangesBuf, scratch, r)
+	}
+
+	var countsBuf bytes.Buffer
+	for i := range gh.Counts {
+		putUvarint(&countsBuf, scratch, atomic.LoadUint64(&gh.Counts[i]))
+	}
+
+	hj := histogramJSON{
+		Version:        histogramWireVersion,
+		NumBins:        len(gh.Ranges),
+		TotCount:       atomic.LoadUint64(&gh.TotCount),
+		TotDataPoint:   atomic.LoadUint64(&gh.TotDataPoint),
+		TotDataPointSq: loadFloat64(&gh.TotDataPointSq),
+		MinDataPoint:   atomic.LoadUint64(&gh.MinDataPoint),
+		MaxDataPoint:   atomic.LoadUint64(&gh.MaxDataPoint),
+		Ranges:         base64.StdEncoding.EncodeToString(rangesBuf.Bytes()),
+		Counts:         base64.StdEncoding.EncodeToString(countsBuf.Bytes()),
+	}
+
+	gh.m.Unlock()
+
+	return json.Marshal(&hj)
+}
+
+// UnmarshalJSON decodes a histogram encoded by MarshalJSON, reading
+// Ranges directly off the wire rather than reconstructing it from
+// construction parameters.
+func (gh *Histogram) UnmarshalJSON(data []byte) error {
+	var hj histogramJSON
+	if err := json.Unmarshal(data, &hj); err != nil {
+		return fmt.Errorf("ghistogram: UnmarshalJSON: %v", err)
+	}
+	if hj.Version != histogramWireVersion {
+		return fmt.Errorf("ghistogram: UnmarshalJSON: unsupported version %d", hj.Version)
+	}
+
+	rangesBytes, err := base64.StdEncoding.DecodeString(hj.Ranges)
+	if err != nil {
+		return fmt.Errorf("ghistogram: UnmarshalJSON: bad ranges: %v", err)
+	}
+	ranges, err := readUvarints(rangesBytes, hj.NumBins)
+	if err != nil {
+		return fmt.Errorf("ghistogram: UnmarshalJSON: bad ranges: %v", err)
+	}
+
+	countsBytes, err := base64.StdEncoding.DecodeString(hj.Counts)
+	if err != nil {
+		return fmt.Errorf("ghistogram: UnmarshalJSON: bad counts: %v", err)
+	}
+	counts, err := readUvarints(countsBytes, hj.NumBins)
+	if err != nil {
+		return fmt.Errorf("ghistogram: UnmarshalJSON: bad counts: %v", err)
+	}
+
+	gh.m.Lock()
+	gh.Ranges = ranges
+	gh.Counts = counts
+	gh.TotCount = hj.TotCount
+	gh.TotDataPoint = hj.TotDataPoint
+	gh.TotDataPointSq = hj.TotDataPointSq
+	gh.MinDataPoint = hj.MinDataPoint
+	gh.MaxDataPoint = hj.MaxDataPoint
+	gh.m.Unlock()
+
+	return nil
+}
+
+// readUvarints decodes exactly want varints from data, erroring if
+// it decodes more, fewer, or hits malformed bytes.
+func readUvarints(data []byte, want int) ([]uint64, error) {
+	r := bytes.NewReader(data)
+	out := make([]uint64, 0, want)
+	for r.Len() > 0 {
+		v, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	if len(out) != want {
+		return nil, fmt.Errorf("length %d != expected %d", len(out), want)
+	}
+	return out, nil
+}
+
+// putUvarint appends the varint encoding of v to buf, using scratch
+// as scratch space (len(scratch) must be >= binary.MaxVarintLen64).
+func putUvarint(buf *bytes.Buffer, scratch []byte, v uint64) {
+	n := binary.PutUvarint(scratch, v)
+	buf.Write(scratch[:n])
+}
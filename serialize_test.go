@@ -0,0 +1,114 @@
+package ghistogram
+
+import (
+	"testing"
+)
+
+func TestHistogramMarshalBinaryRoundTrip(t *testing.T) {
+	gh := NewHistogram(5, 10, 2.0) // Bins: {0, 10, 20, 40, 80}.
+	gh.Add(5, 3)
+	gh.Add(15, 1)
+	gh.Add(1000, 2)
+
+	data, err := gh.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary err: %v", err)
+	}
+
+	gh2 := &Histogram{}
+	if err := gh2.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary err: %v", err)
+	}
+
+	if len(gh2.Ranges) != len(gh.Ranges) {
+		t.Fatalf("Ranges len mismatch: %v vs %v", gh2.Ranges, gh.Ranges)
+	}
+	for i := range gh.Ranges {
+		if gh2.Ranges[i] != gh.Ranges[i] {
+			t.Errorf("Ranges[%d] mismatch: %d vs %d", i, gh2.Ranges[i], gh.Ranges[i])
+		}
+	}
+	for i := range gh.Counts {
+		if gh2.Counts[i] != gh.Counts[i] {
+			t.Errorf("Counts[%d] mismatch: %d vs %d", i, gh2.Counts[i], gh.Counts[i])
+		}
+	}
+	if gh2.TotCount != gh.TotCount || gh2.TotDataPoint != gh.TotDataPoint ||
+		gh2.MinDataPoint != gh.MinDataPoint || gh2.MaxDataPoint != gh.MaxDataPoint {
+		t.Errorf("totals mismatch: %+v vs %+v", gh2, gh)
+	}
+}
+
+func TestHistogramMarshalBinaryRoundTripNonGrowthRanges(t *testing.T) {
+	// Constant-width (binGrowthFactor == 0.0) and log-linear layouts
+	// aren't reproducible from a single (binFirst, growth) pair, so
+	// the wire format must carry Ranges itself rather than replay
+	// NewHistogram.
+	for _, gh := range []*Histogram{
+		NewHistogram(5, 10, 0.0), // Bins: {0, 10, 20, 30, 40}.
+		NewLogLinearHistogram(2, 4),
+	} {
+		gh.Add(5, 3)
+		gh.Add(25, 1)
+
+		data, err := gh.MarshalBinary()
+		if err != nil {
+			t.Fatalf("MarshalBinary err: %v", err)
+		}
+
+		gh2 := &Histogram{}
+		if err := gh2.UnmarshalBinary(data); err != nil {
+			t.Fatalf("UnmarshalBinary err: %v", err)
+		}
+
+		if len(gh2.Ranges) != len(gh.Ranges) {
+			t.Fatalf("Ranges len mismatch: %v vs %v", gh2.Ranges, gh.Ranges)
+		}
+		for i := range gh.Ranges {
+			if gh2.Ranges[i] != gh.Ranges[i] {
+				t.Errorf("Ranges[%d] mismatch: %d vs %d", i, gh2.Ranges[i], gh.Ranges[i])
+			}
+		}
+	}
+}
+
+func TestHistogramUnmarshalBinaryCountsMismatch(t *testing.T) {
+	gh := NewHistogram(5, 10, 2.0)
+	data, err := gh.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary err: %v", err)
+	}
+
+	if err := (&Histogram{}).UnmarshalBinary(data[:len(data)-1]); err == nil {
+		t.Errorf("expected an error unmarshaling truncated Counts")
+	}
+}
+
+func TestHistogramMarshalJSONRoundTrip(t *testing.T) {
+	gh := NewHistogram(5, 10, 2.0)
+	gh.Add(5, 3)
+	gh.Add(15, 1)
+	gh.Add(1000, 2)
+
+	data, err := gh.MarshalJSON()
+	if err != nil {
+		t.Fatalf("MarshalJSON err: %v", err)
+	}
+
+	gh2 := &Histogram{}
+	if err := gh2.UnmarshalJSON(data); err != nil {
+		t.Fatalf("UnmarshalJSON err: %v", err)
+	}
+
+	if len(gh2.Ranges) != len(gh.Ranges) {
+		t.Fatalf("Ranges len mismatch: %v vs %v", gh2.Ranges, gh.Ranges)
+	}
+	for i := range gh.Counts {
+		if gh2.Counts[i] != gh.Counts[i] {
+			t.Errorf("Counts[%d] mismatch: %d vs %d", i, gh2.Counts[i], gh.Counts[i])
+		}
+	}
+	if gh2.TotCount != gh.TotCount {
+		t.Errorf("TotCount mismatch: %d vs %d", gh2.TotCount, gh.TotCount)
+	}
+}
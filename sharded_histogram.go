@@ -0,0 +1,118 @@
+//  Copyright (c) 2015 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the
+//  License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing,
+//  software distributed under the License is distributed on an "AS
+//  IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+//  express or implied. See the License for the specific language
+//  governing permissions and limitations under the License.
+
+package ghistogram
+
+import (
+	"bytes"
+	"unsafe"
+)
+
+// ShardedHistogram spreads Add's across Shards independent
+// Histogram's that share the same Ranges, for workloads where even
+// Histogram's lock-free, atomic-based Add still sees cache-line
+// contention from many goroutines hammering the same Counts
+// entries.  Shards are folded together lazily, only when a reader
+// actually asks for a combined view via EmitGraph, AddAll, or
+// Snapshot.
+type ShardedHistogram struct {
+	// Ranges holds the lower domain bounds of bins, shared by every
+	// shard (see Histogram.Ranges).
+	Ranges []uint64
+
+	// Shards are the independent, per-shard Histogram's that Add
+	// picks amongst.  They all share the same Ranges.
+	Shards []*Histogram
+}
+
+// NewShardedHistogram creates a new, ready to use ShardedHistogram
+// with the given number of shards, each laid out exactly as
+// NewHistogram(numBins, binFirst, binGrowthFactor) would be.  A
+// shards <= 0 behaves as shards == 1.
+func NewShardedHistogram(
+	numBins int,
+	binFirst uint64,
+	binGrowthFactor float64,
+	shards int) *ShardedHistogram {
+	if shards <= 0 {
+		shards = 1
+	}
+
+	sh := &ShardedHistogram{
+		Shards: make([]*Histogram, shards),
+	}
+
+	for i := 0; i < shards; i++ {
+		sh.Shards[i] = NewHistogram(numBins, binFirst, binGrowthFactor)
+	}
+
+	sh.Ranges = sh.Shards[0].Ranges
+
+	return sh
+}
+
+// Add increases the count for dataPoint in a single shard, chosen
+// by a cheap, allocation-free, per-goroutine differentiator (the address
+// of a stack-local variable) rather than an atomic round-robin
+// counter, so picking a shard never itself becomes a point of
+// contention.
+func (sh *ShardedHistogram) Add(dataPoint uint64, count uint64) {
+	sh.Shards[sh.shardFor()].Add(dataPoint, count)
+}
+
+// shardFor picks a pseudo-random shard index by hashing the address
+// of a stack-local variable.  Goroutines have distinct stacks, so the
+// index varies goroutine to goroutine; a goroutine calling from the
+// same stack depth keeps getting the same shard.  Goroutine stacks
+// are aligned, leaving the address's low bits equal across
+// goroutines, so the whole address is mixed by a multiplicative hash.
+func (sh *ShardedHistogram) shardFor() int {
+	var x byte
+	h := uint64(uintptr(unsafe.Pointer(&x))) * 0x9E3779B97F4A7C15
+
+	return int((h >> 32) % uint64(len(sh.Shards)))
+}
+
+// Snapshot folds all the Shards together into a single, independent
+// Histogram with the same Ranges.
+func (sh *ShardedHistogram) Snapshot() *Histogram {
+	merged := &Histogram{
+		Ranges:       sh.Ranges,
+		Counts:       make([]uint64, len(sh.Ranges)),
+		MinDataPoint: ^uint64(0), // math.MaxUint64, same starting point as NewHistogram.
+	}
+
+	for _, shard := range sh.Shards {
+		merged.AddAll(shard)
+	}
+
+	return merged
+}
+
+// EmitGraph folds the Shards together (see Snapshot) and emits an
+// ascii graph of the result, just like Histogram.EmitGraph.
+func (sh *ShardedHistogram) EmitGraph(prefix []byte, out *bytes.Buffer) *bytes.Buffer {
+	return sh.Snapshot().EmitGraph(prefix, out)
+}
+
+// AddAll adds all the counts from the src ShardedHistogram into this
+// one, shard by corresponding shard when the shard counts match, or
+// via a folded Snapshot of src otherwise.
+func (sh *ShardedHistogram) AddAll(src *ShardedHistogram) {
+	if len(src.Shards) == len(sh.Shards) {
+		for i, shard := range src.Shards {
+			sh.Shards[i].AddAll(shard)
+		}
+		return
+	}
+
+	sh.Shards[0].AddAll(src.Snapshot())
+}
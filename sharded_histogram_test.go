@@ -0,0 +1,95 @@
+package ghistogram
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestShardedHistogramAdd(t *testing.T) {
+	sh := NewShardedHistogram(5, 10, 2.0, 4) // Bins: {0, 10, 20, 40, 80}.
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				sh.Add(15, 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	snap := sh.Snapshot()
+	if snap.TotCount != 8000 {
+		t.Errorf("expected TotCount 8000, got %d", snap.TotCount)
+	}
+	if snap.Counts[1] != 8000 {
+		t.Errorf("expected bin 1 count 8000, got %d", snap.Counts[1])
+	}
+}
+
+func TestShardedHistogramAddAll(t *testing.T) {
+	a := NewShardedHistogram(5, 10, 2.0, 2)
+	b := NewShardedHistogram(5, 10, 2.0, 2)
+
+	a.Add(5, 3)
+	b.Add(15, 4)
+
+	a.AddAll(b)
+
+	snap := a.Snapshot()
+	if snap.TotCount != 7 {
+		t.Errorf("expected TotCount 7, got %d", snap.TotCount)
+	}
+}
+
+func TestHistogramAddConcurrent(t *testing.T) {
+	gh := NewHistogram(5, 10, 2.0)
+
+	var wg sync.WaitGroup
+	for g := 0; g < 16; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				gh.Add(15, 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if gh.TotCount != 16000 {
+		t.Errorf("expected TotCount 16000, got %d", gh.TotCount)
+	}
+	if gh.Counts[1] != 16000 {
+		t.Errorf("expected bin 1 count 16000, got %d", gh.Counts[1])
+	}
+}
+
+// TestHistogramAddConcurrentWithReaders exercises Add racing readers
+// that touch the same fields (EmitGraph, Quantile, StdDev, AddAll),
+// to catch the data race where a reader used a plain field access
+// against Add's atomic writes.  Run with -race to verify.
+func TestHistogramAddConcurrentWithReaders(t *testing.T) {
+	gh := NewHistogram(5, 10, 2.0)
+	other := NewHistogram(5, 10, 2.0)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			gh.Add(uint64(i%100), 1)
+		}
+	}()
+
+	for i := 0; i < 1000; i++ {
+		gh.EmitGraph(nil, nil)
+		gh.Quantile(0.5)
+		gh.StdDev()
+		other.AddAll(gh)
+	}
+
+	wg.Wait()
+}
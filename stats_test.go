@@ -0,0 +1,80 @@
+package ghistogram
+
+import (
+	"math"
+	"testing"
+)
+
+func TestHistogramQuantiles(t *testing.T) {
+	gh := NewHistogram(5, 10, 2.0) // Bins: {0, 10, 20, 40, 80}.
+
+	for i := 0; i < 100; i++ {
+		gh.Add(15, 1)
+	}
+
+	got := gh.Quantiles([]float64{0.99, 0.5, 0.01})
+	want := []uint64{gh.Quantile(0.99), gh.Quantile(0.5), gh.Quantile(0.01)}
+
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Quantiles()[%d] = %d, want %d (matching single Quantile call)",
+				i, got[i], want[i])
+		}
+	}
+}
+
+func TestHistogramCDF(t *testing.T) {
+	gh := NewHistogram(5, 10, 2.0)
+
+	if gh.CDF(10) != 0 {
+		t.Errorf("expected CDF of empty histogram to be 0")
+	}
+
+	for i := 0; i < 100; i++ {
+		gh.Add(15, 1)
+	}
+
+	if got := gh.CDF(5); got != 0 {
+		t.Errorf("expected CDF(5) == 0, got %v", got)
+	}
+	if got := gh.CDF(1000); got != 1 {
+		t.Errorf("expected CDF(1000) == 1, got %v", got)
+	}
+}
+
+func TestHistogramMeanStdDev(t *testing.T) {
+	gh := NewHistogram(5, 10, 2.0)
+
+	if gh.Mean() != 0 || gh.StdDev() != 0 {
+		t.Errorf("expected Mean/StdDev of empty histogram to be 0")
+	}
+
+	vals := []uint64{2, 4, 4, 4, 5, 5, 7, 9}
+	for _, v := range vals {
+		gh.Add(v, 1)
+	}
+
+	if got, want := gh.Mean(), 5.0; math.Abs(got-want) > 0.001 {
+		t.Errorf("Mean() = %v, want %v", got, want)
+	}
+	if got, want := gh.StdDev(), 2.0; math.Abs(got-want) > 0.001 {
+		t.Errorf("StdDev() = %v, want %v", got, want)
+	}
+}
+
+func TestHistogramStdDevLargeValues(t *testing.T) {
+	// A uint64 sum of squares overflows well before TotCount reaches
+	// this many samples at this magnitude (~1e9 squared is ~1e18,
+	// close to uint64's ~1.8e19 ceiling); TotDataPointSq must be wide
+	// enough to not wrap around and produce a garbage StdDev.
+	gh := NewHistogram(2, math.MaxUint32, 0.0)
+
+	const v = uint64(1e9)
+	for i := 0; i < 1000; i++ {
+		gh.Add(v, 1)
+	}
+
+	if got, want := gh.StdDev(), 0.0; math.Abs(got-want) > 0.001 {
+		t.Errorf("StdDev() of identical large values = %v, want %v", got, want)
+	}
+}